@@ -72,15 +72,63 @@ type vintfCompatibilityMatrixProperties struct {
 
 	// Type of the FCM type, the allowed type are device_fcm and product_fcm and it should only be used under hardware/interfaces/compatibility_matrices
 	Type *string
+
+	// Minimum SDK version that this compatibility matrix can be packaged in, when it is
+	// included in an APEX via CreateApexVariations. Has no effect otherwise.
+	Min_sdk_version *string
+
+	// Board_srcs adds to Srcs based on the board/product soong config string variable
+	// "platform" in the soongConfigNamespace namespace, e.g. with
+	// PRODUCT_SOONG_CONFIG_NAMESPACES/VARIABLES set so that namespace's "platform" variable is
+	// "msmnile" on a given board:
+	//
+	//	vintf_compatibility_matrix {
+	//	    name: "my_fcm",
+	//	    board_srcs: [
+	//	        { value: "msmnile", srcs: ["msmnile_matrix.xml"] },
+	//	        { value: "taimen", srcs: ["taimen_matrix.xml"] },
+	//	    ],
+	//	}
+	//
+	// selects msmnile_matrix.xml as an extra src only for boards where that variable is set to
+	// "msmnile". This lets one BUILD file cover several board variants instead of forking the
+	// .bp per variant or generating it out-of-band.
+	Board_srcs []vintfCompatibilityMatrixBoardSrcs
+
+	// Lts_kernel_configs adds to Kernel_configs when the board/product soong config bool
+	// variable "use_lts_kernel" in the soongConfigNamespace namespace is true.
+	Lts_kernel_configs []string
+}
+
+type vintfCompatibilityMatrixBoardSrcs struct {
+	// the soong config value of "platform" this entry's Srcs apply to
+	Value *string
+
+	// extra source compatibility matrix XML files added to Srcs when Value matches
+	Srcs []string
 }
 
+// soongConfigNamespace is the soong config namespace (set via PRODUCT_SOONG_CONFIG_NAMESPACES in
+// a product makefile) that Board_srcs/Lts_kernel_configs are read from.
+const soongConfigNamespace = "vintf_compatibility_matrix"
+
 type vintfCompatibilityMatrixRule struct {
 	android.ModuleBase
+	android.ApexModuleBase
 	properties vintfCompatibilityMatrixProperties
 
 	genFile                android.WritablePath
+	noticeFile             android.WritablePath
 	additionalDependencies android.WritablePaths
 	phonyOnly              bool
+
+	// Resolved inputs to the assemble_vintf invocation that produced genFile, kept around so the
+	// vintf_snapshot singleton can capture a hermetic reproduction of this module without
+	// re-deriving them.
+	inputPaths             android.Paths
+	frameworkRuleImplicits android.Paths
+	assembleVintfEnv       string
+	assembleVintfExtraArgs []string
 }
 
 func init() {
@@ -94,10 +142,61 @@ func vintfCompatibilityMatrixFactory() android.Module {
 	g := &vintfCompatibilityMatrixRule{}
 	g.AddProperties(&g.properties)
 	android.InitAndroidArchModule(g, android.DeviceSupported, android.MultilibCommon)
+	android.InitApexModule(g)
+	android.AddLoadHook(g, g.loadHookSoongConfigVariables)
 	return g
 }
 
+// loadHookSoongConfigVariables merges Board_srcs/Lts_kernel_configs into Srcs/Kernel_configs
+// based on the board/product soong config variables in soongConfigNamespace, before
+// DepsMutator/GenerateAndroidBuildActions ever look at those fields.
+func (g *vintfCompatibilityMatrixRule) loadHookSoongConfigVariables(ctx android.LoadHookContext) {
+	vendorConfig := ctx.Config().VendorConfig(soongConfigNamespace)
+
+	if platform, ok := vendorConfig.String("platform"); ok {
+		for _, boardSrcs := range g.properties.Board_srcs {
+			if proptools.String(boardSrcs.Value) == platform {
+				g.properties.Srcs = append(g.properties.Srcs, boardSrcs.Srcs...)
+			}
+		}
+	}
+
+	if vendorConfig.Bool("use_lts_kernel") {
+		g.properties.Kernel_configs = append(g.properties.Kernel_configs, g.properties.Lts_kernel_configs...)
+	}
+}
+
 var _ android.AndroidMkDataProvider = (*vintfCompatibilityMatrixRule)(nil)
+var _ android.ApexModule = (*vintfCompatibilityMatrixRule)(nil)
+
+// CanHaveApexVariants lets a vintf_compatibility_matrix participate in apex_available /
+// CreateApexVariations like any other ApexModule, so a variant of this module can be built for
+// each APEX that depends on it. This alone does not make any `apex` property (e.g. a would-be
+// `vintf_fragments_matrices`) aware of this module type; wiring an `apex` module to actually
+// depend on a vintf_compatibility_matrix and pull its installed output into the payload is
+// separate, not-yet-done work on the apex side.
+func (g *vintfCompatibilityMatrixRule) CanHaveApexVariants() bool {
+	return true
+}
+
+// MinSdkVersion implements android.ApexModule so the apex dependency mutator can check this
+// module's declared minimum SDK version against the APEXes that depend on it. It does not affect
+// which schema or assemble_vintf behavior is used for validation (see getSchema, which always
+// resolves the single, version-agnostic compatibility_matrix_schema dependency); Min_sdk_version
+// is optional, so an unset value must not be treated as an invalid one.
+func (g *vintfCompatibilityMatrixRule) MinSdkVersion(ctx android.EarlyModuleContext) android.ApiLevel {
+	if proptools.String(g.properties.Min_sdk_version) == "" {
+		return android.NoneApiLevel
+	}
+	return android.ApiLevelOrPanic(ctx, proptools.String(g.properties.Min_sdk_version))
+}
+
+// isApexVariant reports whether this module is being built as part of an APEX payload rather
+// than for the platform (/system) partition.
+func (g *vintfCompatibilityMatrixRule) isApexVariant(ctx android.ModuleContext) bool {
+	apexInfo, ok := android.ModuleProvider(ctx, android.ApexInfoProvider)
+	return ok && !apexInfo.IsForPlatform()
+}
 
 func (g *vintfCompatibilityMatrixRule) DepsMutator(ctx android.BottomUpMutatorContext) {
 	android.ExtractSourcesDeps(ctx, g.properties.Srcs)
@@ -140,6 +239,49 @@ func (g *vintfCompatibilityMatrixRule) getSchema(ctx android.ModuleContext) andr
 	return android.OptionalPathForPath(schemaSrcs[0])
 }
 
+// setLicensesInfo aggregates this module's own declared/package-default licenses (which, since
+// emptyManifest and compatibilityEmptyMatrix live in this same package, already covers those two
+// static defaults) with those of every module this rule pulled content from (kernel_configs, the
+// matrix schema), and publishes the result so the merged matrix is visible to the SBOM/NOTICE
+// pipeline even though it isn't a plain copy of any single licensed source.
+//
+// This intentionally does not attempt to attribute licensing for the product/device-supplied
+// DEVICE_*_COMPATIBILITY_MATRIX_FILE content: that path is resolved dynamically from product
+// config rather than through a static module or `android:"path"` property dependency, so it
+// can't be reached by the generic license-collection machinery here. Licensing that content
+// correctly remains the owning device tree's responsibility, same as any other DEVICE_*-supplied
+// prebuilt consumed elsewhere in the build.
+func (g *vintfCompatibilityMatrixRule) setLicensesInfo(ctx android.ModuleContext) android.Paths {
+	licenseFiles := append(android.Paths{}, ctx.Module().EffectiveLicenseFiles()...)
+	ctx.VisitDirectDeps(func(dep android.Module) {
+		if info, ok := android.OtherModuleProvider(ctx, dep, android.LicensesInfoProvider); ok {
+			licenseFiles = append(licenseFiles, info.Licenses...)
+		}
+	})
+	licenseFiles = android.FirstUniquePaths(licenseFiles)
+
+	android.SetProvider(ctx, android.LicensesInfoProvider, android.LicensesInfo{
+		Licenses: licenseFiles,
+	})
+	return licenseFiles
+}
+
+// generateNoticeBuildAction concatenates the aggregated license files into a single NOTICE file
+// that gets installed alongside the matrix, so the output is self-describing even outside of the
+// central NOTICE pipeline.
+func (g *vintfCompatibilityMatrixRule) generateNoticeBuildAction(ctx android.ModuleContext, outputFilename string, licenseFiles android.Paths) {
+	if len(licenseFiles) == 0 {
+		return
+	}
+	g.noticeFile = android.PathForModuleGen(ctx, outputFilename+".notice.txt")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        android.Cat,
+		Description: "vintf notice",
+		Inputs:      licenseFiles,
+		Output:      g.noticeFile,
+	})
+}
+
 func (g *vintfCompatibilityMatrixRule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	// Types attribute only allow `device_fcm` or `product_fcm` if set and only restricted it being used under
 	// `hardware/interfaces/compatibility_matrices` to prevent accidental external usages.
@@ -205,10 +347,11 @@ func (g *vintfCompatibilityMatrixRule) GenerateAndroidBuildActions(ctx android.M
 
 	if matrixType == deviceFcmType {
 		frameworkMatrixs := android.PathsForSource(ctx, ctx.Config().DeviceFrameworkCompatibilityMatrixFile())
-		if len(frameworkMatrixs) > 0 {
+		if len(frameworkMatrixs) > 0 && !g.isApexVariant(ctx) {
 			inputPaths = append(inputPaths, frameworkMatrixs...)
 
-			// Generate BuildAction for generating the check manifest.
+			// Generate BuildAction for generating the check manifest. APEX variants don't own
+			// sepolicy, so this step only applies to the platform variant.
 			emptyManifestPath := android.PathForSource(ctx, emptyManifest)
 			genCheckManifest := android.PathForModuleGen(ctx, "manifest.check.xml")
 			checkManifestInputs := []android.Path{emptyManifestPath}
@@ -238,6 +381,7 @@ func (g *vintfCompatibilityMatrixRule) GenerateAndroidBuildActions(ctx android.M
 
 	g.genFile = android.PathForModuleGen(ctx, outputFilename)
 	frameworkRuleImplicits = append(frameworkRuleImplicits, inputPaths...)
+	assembleVintfEnv := g.getAssembleVintfEnv(ctx)
 
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        assembleVintfRule,
@@ -247,12 +391,26 @@ func (g *vintfCompatibilityMatrixRule) GenerateAndroidBuildActions(ctx android.M
 		Args: map[string]string{
 			"inputs":           strings.Join(inputPaths.Strings(), ":"),
 			"extraArgs":        strings.Join(extraArgs, " "),
-			"assembleVintfEnv": g.getAssembleVintfEnv(ctx),
+			"assembleVintfEnv": assembleVintfEnv,
 		},
 	})
 	g.generateValidateBuildAction(ctx, g.genFile, schema.Path())
 
+	g.inputPaths = inputPaths
+	g.frameworkRuleImplicits = frameworkRuleImplicits
+	g.assembleVintfExtraArgs = extraArgs
+	g.assembleVintfEnv = assembleVintfEnv
+
+	licenseFiles := g.setLicensesInfo(ctx)
+	g.generateNoticeBuildAction(ctx, outputFilename, licenseFiles)
+
+	// android.PathForModuleInstall is APEX-variant aware: for a platform variant this resolves
+	// under /system/etc/vintf, and for an APEX variant it resolves under etc/vintf inside the
+	// APEX payload.
 	ctx.InstallFile(android.PathForModuleInstall(ctx, "etc", relpath), outputFilename, g.genFile)
+	if g.noticeFile != nil {
+		ctx.InstallFile(android.PathForModuleInstall(ctx, "etc", relpath), outputFilename+".NOTICE", g.noticeFile)
+	}
 }
 
 func (g *vintfCompatibilityMatrixRule) getAssembleVintfEnv(ctx android.ModuleContext) string {
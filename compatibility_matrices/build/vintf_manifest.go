@@ -0,0 +1,235 @@
+// Copyright (C) 2024 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vintf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+	"android/soong/kernel/configs"
+)
+
+var (
+	fragmentTag        = dependencyTag{name: "manifest-fragment"}
+	manifestSchemaTag  = dependencyTag{name: "manifest-schema"}
+	manifestSchemaName = "manifest_schema"
+)
+
+const (
+	deviceManifestType    = "device"
+	frameworkManifestType = "framework"
+	productManifestType   = "product"
+	systemExtManifestType = "system_ext"
+)
+
+// vintfManifestProperties describes the inputs to a vintf_manifest module.
+type vintfManifestProperties struct {
+	// set the name of the output
+	Stem *string
+
+	// list of source manifest XML files; for a top-level manifest this is the base manifest,
+	// for a fragment this is the fragment itself
+	Srcs []string
+
+	// list of kernel_config modules to be combined into the final output. Only honored when
+	// Type is "device".
+	Kernel_configs []string
+
+	// list of other vintf_manifest modules (and any other module implementing
+	// android.SourceFileProducer, e.g. a genrule or filegroup) whose srcs are merged into this
+	// manifest. NOTE: cc_library modules exporting a vintf_fragments XML are not yet supported
+	// here; cc.Module does not implement android.SourceFileProducer for that output, so wiring
+	// that in is follow-up work, not something this module type does today.
+	Fragments []string
+
+	// Type of the manifest, one of "device", "framework", "product" or "system_ext". When set,
+	// this module is installed as the partition's top-level manifest.xml. When unset, this
+	// module is a fragment meant to be referenced from another vintf_manifest's fragments
+	// property, and is installed under etc/vintf/manifest/ instead.
+	Type *string
+}
+
+type vintfManifestRule struct {
+	android.ModuleBase
+	properties vintfManifestProperties
+
+	genFile                android.WritablePath
+	additionalDependencies android.WritablePaths
+}
+
+func init() {
+	android.RegisterModuleType("vintf_manifest", vintfManifestFactory)
+}
+
+func vintfManifestFactory() android.Module {
+	g := &vintfManifestRule{}
+	g.AddProperties(&g.properties)
+	android.InitAndroidArchModule(g, android.DeviceSupported, android.MultilibCommon)
+	return g
+}
+
+var _ android.AndroidMkDataProvider = (*vintfManifestRule)(nil)
+var _ android.SourceFileProducer = (*vintfManifestRule)(nil)
+
+func (g *vintfManifestRule) DepsMutator(ctx android.BottomUpMutatorContext) {
+	android.ExtractSourcesDeps(ctx, g.properties.Srcs)
+	if proptools.String(g.properties.Type) == deviceManifestType {
+		ctx.AddDependency(ctx.Module(), kernelConfigTag, g.properties.Kernel_configs...)
+	}
+	ctx.AddDependency(ctx.Module(), fragmentTag, g.properties.Fragments...)
+	ctx.AddDependency(ctx.Module(), manifestSchemaTag, manifestSchemaName)
+}
+
+func (g *vintfManifestRule) timestampFilePath(ctx android.ModuleContext, path android.Path) android.WritablePath {
+	return android.GenPathWithExt(ctx, "vintf-xmllint", path, "ts")
+}
+
+func (g *vintfManifestRule) generateValidateBuildAction(ctx android.ModuleContext, path android.Path, schema android.Path) {
+	timestamp := g.timestampFilePath(ctx, path)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        xmllintXsd,
+		Description: "xmllint-xsd",
+		Input:       path,
+		Output:      timestamp,
+		Implicit:    schema,
+		Args: map[string]string{
+			"xsd": schema.String(),
+		},
+	})
+	g.additionalDependencies = append(g.additionalDependencies, timestamp)
+}
+
+func (g *vintfManifestRule) getSchema(ctx android.ModuleContext) android.OptionalPath {
+	schemaModule := ctx.GetDirectDepWithTag(manifestSchemaName, manifestSchemaTag)
+	sfp, ok := schemaModule.(android.SourceFileProducer)
+	if !ok {
+		ctx.ModuleErrorf("Implicit dependency %q has no srcs", ctx.OtherModuleName(schemaModule))
+		return android.OptionalPath{}
+	}
+
+	schemaSrcs := sfp.Srcs()
+	if len(schemaSrcs) != 1 {
+		ctx.PropertyErrorf(`srcs of implicit dependency %q has length %d != 1`, ctx.OtherModuleName(schemaModule), len(schemaSrcs))
+		return android.OptionalPath{}
+	}
+	return android.OptionalPathForPath(schemaSrcs[0])
+}
+
+func (g *vintfManifestRule) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	manifestType := proptools.String(g.properties.Type)
+	switch manifestType {
+	case "", deviceManifestType, frameworkManifestType, productManifestType, systemExtManifestType:
+		// valid
+	default:
+		panic(fmt.Errorf("The attribute 'type' value must be one of 'device', 'framework', 'product' or 'system_ext' if set!"))
+	}
+
+	outputFilename := proptools.String(g.properties.Stem)
+	if outputFilename == "" {
+		// A typed module is the partition's single top-level manifest, so "manifest.xml" is
+		// unambiguous. An untyped (fragment) module can coexist with any number of other
+		// fragments under the same etc/vintf/manifest/ directory, so fall back to the module
+		// name like vintf_compatibility_matrix does, to avoid every unstemmed fragment
+		// colliding on the same install path.
+		if manifestType == "" {
+			outputFilename = g.Name()
+		} else {
+			outputFilename = "manifest.xml"
+		}
+	}
+
+	schema := g.getSchema(ctx)
+	if !schema.Valid() {
+		return
+	}
+
+	inputPaths := android.PathsForModuleSrc(ctx, g.properties.Srcs)
+	for _, srcPath := range inputPaths {
+		g.generateValidateBuildAction(ctx, srcPath, schema.Path())
+	}
+
+	// Kernel configs auto-fill the <kernel> tag of a device manifest.
+	ctx.VisitDirectDepsWithTag(kernelConfigTag, func(m android.Module) {
+		if k, ok := m.(*configs.KernelConfigRule); ok {
+			inputPaths = append(inputPaths, k.OutputPath())
+		} else {
+			ctx.PropertyErrorf("kernel_configs",
+				"module %q is not a kernel_config", ctx.OtherModuleName(m))
+		}
+	})
+
+	// Fragments let a device compose its manifest out of other vintf_manifest modules (or any
+	// other android.SourceFileProducer) instead of via DEVICE_MANIFEST_FILE.
+	ctx.VisitDirectDepsWithTag(fragmentTag, func(m android.Module) {
+		sfp, ok := m.(android.SourceFileProducer)
+		if !ok {
+			ctx.PropertyErrorf("fragments", "module %q does not produce any srcs", ctx.OtherModuleName(m))
+			return
+		}
+		inputPaths = append(inputPaths, sfp.Srcs()...)
+	})
+
+	g.genFile = android.PathForModuleGen(ctx, outputFilename)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        assembleVintfRule,
+		Description: "Assemble VINTF Manifest",
+		Implicits:   inputPaths,
+		Output:      g.genFile,
+		Args: map[string]string{
+			"inputs":           strings.Join(inputPaths.Strings(), ":"),
+			"extraArgs":        "",
+			"assembleVintfEnv": "",
+		},
+	})
+	g.generateValidateBuildAction(ctx, g.genFile, schema.Path())
+
+	// A typed manifest is the partition's top-level manifest.xml; an untyped one is a fragment
+	// meant to be merged into another vintf_manifest and is installed under etc/vintf/manifest/.
+	installRelPath := relpath
+	if manifestType == "" {
+		installRelPath = relpath + "/manifest"
+	}
+	ctx.InstallFile(android.PathForModuleInstall(ctx, "etc", installRelPath), outputFilename, g.genFile)
+}
+
+func (g *vintfManifestRule) Srcs() android.Paths {
+	return android.Paths{g.genFile}
+}
+
+func (g *vintfManifestRule) AndroidMk() android.AndroidMkData {
+	return android.AndroidMkData{
+		Class:      "ETC",
+		OutputFile: android.OptionalPathForPath(g.genFile),
+		Extra: []android.AndroidMkExtraFunc{
+			func(w io.Writer, outputFile android.Path) {
+				installRelPath := relpath
+				if proptools.String(g.properties.Type) == "" {
+					installRelPath = relpath + "/manifest"
+				}
+				fmt.Fprintln(w, "LOCAL_MODULE_RELATIVE_PATH :=", installRelPath)
+				// Stem, "manifest.xml" or the module name, as chosen in GenerateAndroidBuildActions.
+				fmt.Fprintln(w, "LOCAL_MODULE_STEM :=", outputFile.Base())
+				for _, path := range g.additionalDependencies {
+					fmt.Fprintln(w, "LOCAL_ADDITIONAL_DEPENDENCIES +=", path.String())
+				}
+			},
+		},
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2024 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vintf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+var vintfSnapshotTarRule = pctx.AndroidStaticRule("vintf_snapshot_tar", blueprint.RuleParams{
+	Command:     `tar -czf ${out} -T ${filelist}`,
+	Description: "vintf_snapshot.tar.gz",
+}, "filelist")
+
+// vintfSnapshotProperties is a marker module: declaring one turns the vintf_snapshot singleton
+// on (without one, no snapshot is built) and lets a BUILD file customize the Stem of the
+// resulting tarball. It doesn't change what gets captured: the singleton always walks every
+// vintf_compatibility_matrix in the tree.
+type vintfSnapshotProperties struct {
+	// set the name of the output tarball, defaults to vintf_snapshot.tar.gz
+	Stem *string
+}
+
+type vintfSnapshotModule struct {
+	android.ModuleBase
+	properties vintfSnapshotProperties
+}
+
+func init() {
+	android.RegisterModuleType("vintf_snapshot", vintfSnapshotModuleFactory)
+	android.RegisterSingletonType("vintf_snapshot", vintfSnapshotSingletonFactory)
+}
+
+func vintfSnapshotModuleFactory() android.Module {
+	m := &vintfSnapshotModule{}
+	m.AddProperties(&m.properties)
+	android.InitAndroidModule(m)
+	return m
+}
+
+// GenerateAndroidBuildActions is intentionally empty: all of the real work happens in the
+// vintf_snapshot singleton below, which has visibility into every vintf_compatibility_matrix in
+// the tree. This module only exists so a BUILD file can request and customize the snapshot.
+func (m *vintfSnapshotModule) GenerateAndroidBuildActions(ctx android.ModuleContext) {}
+
+type vintfSnapshotEntry struct {
+	Name      string   `json:"name"`
+	Output    string   `json:"output"`
+	Inputs    []string `json:"inputs"`
+	Implicits []string `json:"implicits"`
+	ExtraArgs []string `json:"extra_args"`
+	Env       string   `json:"assemble_vintf_env"`
+}
+
+type vintfSnapshotNamedFiles struct {
+	entry vintfSnapshotEntry
+	files android.Paths
+}
+
+type vintfSnapshotSingleton struct{}
+
+func vintfSnapshotSingletonFactory() android.Singleton {
+	return &vintfSnapshotSingleton{}
+}
+
+// GenerateBuildActions walks every vintf_compatibility_matrix in the tree and packages a
+// reproduction of each: the resolved source XMLs, kernel_config outputs, the empty matrix
+// default where it was used, the generated check manifest, and the exact assembleVintfEnv and
+// extraArgs (e.g. the "-c" check-manifest flag for device/product FCMs) used, plus a shell
+// script that re-runs assemble_vintf with the same arguments outside of a Soong checkout.
+// The tarball does not contain the schema XSD or the empty manifest (which a product FCM's
+// "-c" argument names).
+// Partners can use this to reproduce and diff FCMs across branches or vendor drops, and CI can
+// use it as a stable artifact for compatibility regression tests.
+func (s *vintfSnapshotSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	stem := "vintf_snapshot.tar.gz"
+
+	// This is opt-in: only capture a snapshot when some BUILD file actually declares a
+	// vintf_snapshot module, so trees that don't ask for this don't pay for the extra tar/dist
+	// build action on every build.
+	requested := false
+	byName := map[string]vintfSnapshotNamedFiles{}
+	isPlatformByName := map[string]bool{}
+
+	ctx.VisitAllModules(func(m android.Module) {
+		if snap, ok := m.(*vintfSnapshotModule); ok {
+			requested = true
+			if s := proptools.String(snap.properties.Stem); s != "" {
+				stem = s
+			}
+			return
+		}
+
+		g, ok := m.(*vintfCompatibilityMatrixRule)
+		if !ok || g.phonyOnly || g.genFile == nil {
+			return
+		}
+
+		// A module with apex_available set gets one variant per APEX plus the platform variant,
+		// all sharing the same module name. Their inputs/env can differ (e.g. only the platform
+		// variant runs the framework-check-manifest step, see chunk0-1), so pick the platform
+		// variant deterministically instead of whichever one VisitAllModules happens to reach
+		// first.
+		name := ctx.ModuleName(m)
+		isPlatform := true
+		if apexInfo, ok := android.OtherModuleProvider(ctx, m, android.ApexInfoProvider); ok {
+			isPlatform = apexInfo.IsForPlatform()
+		}
+		if isPlatformByName[name] && !isPlatform {
+			return
+		}
+
+		files := append(android.Paths{}, g.inputPaths...)
+		files = append(files, g.frameworkRuleImplicits...)
+
+		byName[name] = vintfSnapshotNamedFiles{
+			entry: vintfSnapshotEntry{
+				Name:      name,
+				Output:    g.genFile.String(),
+				Inputs:    g.inputPaths.Strings(),
+				Implicits: g.frameworkRuleImplicits.Strings(),
+				ExtraArgs: g.assembleVintfExtraArgs,
+				Env:       g.assembleVintfEnv,
+			},
+			files: files,
+		}
+		isPlatformByName[name] = isPlatform
+	})
+
+	if !requested || len(byName) == 0 {
+		return
+	}
+
+	var entries []vintfSnapshotEntry
+	var allFiles android.Paths
+	for _, nf := range byName {
+		entries = append(entries, nf.entry)
+		allFiles = append(allFiles, nf.files...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	allFiles = android.FirstUniquePaths(allFiles)
+
+	manifestJSON, err := json.MarshalIndent(struct {
+		Matrices []vintfSnapshotEntry `json:"matrices"`
+	}{entries}, "", "  ")
+	if err != nil {
+		ctx.Errorf("vintf_snapshot: failed to marshal manifest.json: %s", err)
+		return
+	}
+
+	manifestPath := android.PathForOutput(ctx, "vintf_snapshot", "manifest.json")
+	android.WriteFileRule(ctx, manifestPath, string(manifestJSON))
+
+	var rerun strings.Builder
+	rerun.WriteString("#!/bin/bash\n")
+	rerun.WriteString("# Re-runs assemble_vintf for every FCM captured in manifest.json, using the\n")
+	rerun.WriteString("# same inputs and environment as the original Soong build.\n")
+	rerun.WriteString("set -e\n")
+	// The recorded env is a ninja rule argument; undo its "$$" escaping and the ninja
+	// ${AvbToolCmd} variable so bash sees the same command substitution.
+	unNinja := strings.NewReplacer("${AvbToolCmd}", "avbtool", "$$", "$")
+	for _, e := range entries {
+		rerun.WriteString(fmt.Sprintf("\n# %s\n", e.Name))
+		rerun.WriteString(fmt.Sprintf("%s assemble_vintf -i %s -o %s %s\n",
+			unNinja.Replace(e.Env), strings.Join(e.Inputs, ":"), e.Name+".out.xml", strings.Join(e.ExtraArgs, " ")))
+	}
+	rerunPath := android.PathForOutput(ctx, "vintf_snapshot", "rerun.sh")
+	android.WriteFileRule(ctx, rerunPath, rerun.String())
+
+	var fileList strings.Builder
+	fileList.WriteString(manifestPath.String() + "\n")
+	fileList.WriteString(rerunPath.String() + "\n")
+	for _, f := range allFiles {
+		fileList.WriteString(f.String() + "\n")
+	}
+	fileListPath := android.PathForOutput(ctx, "vintf_snapshot", "tar.filelist")
+	android.WriteFileRule(ctx, fileListPath, fileList.String())
+
+	snapshotPath := android.PathForOutput(ctx, stem)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        vintfSnapshotTarRule,
+		Description: "vintf_snapshot.tar.gz",
+		Output:      snapshotPath,
+		Input:       fileListPath,
+		Implicits:   append(android.Paths{manifestPath, rerunPath}, allFiles...),
+		Args: map[string]string{
+			"filelist": fileListPath.String(),
+		},
+	})
+
+	ctx.DistForGoal("droidcore", snapshotPath)
+}